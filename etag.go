@@ -0,0 +1,114 @@
+package webdavwithpath
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/net/webdav"
+)
+
+// eTag is a parsed RFC 7232 entity-tag: an opaque quoted value plus its
+// weak/strong flag.
+type eTag struct {
+	weak  bool
+	value string
+}
+
+// strongEquals implements the RFC 7232 section 2.3.2 strong comparison
+// function: both tags must be strong and byte-for-byte identical.
+func (a eTag) strongEquals(b eTag) bool {
+	return !a.weak && !b.weak && a.value == b.value
+}
+
+// weakEquals implements the RFC 7232 section 2.3.2 weak comparison
+// function: the weak/strong flag is ignored.
+func (a eTag) weakEquals(b eTag) bool {
+	return a.value == b.value
+}
+
+// parseSingleETag parses one entity-tag, e.g. `"abc"` or `W/"abc"`.
+func parseSingleETag(s string) (eTag, bool) {
+	s = strings.TrimSpace(s)
+	weak := false
+	if rest, ok := strings.CutPrefix(s, "W/"); ok {
+		weak, s = true, rest
+	}
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return eTag{}, false
+	}
+	return eTag{weak: weak, value: s[1 : len(s)-1]}, true
+}
+
+// parseETagList parses the comma-separated entity-tag list used by If-Match
+// and If-None-Match, per RFC 7232 section 3.1/3.2.
+func parseETagList(s string) (tags []eTag, ok bool) {
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		t, ok := parseSingleETag(part)
+		if !ok {
+			return nil, false
+		}
+		tags = append(tags, t)
+	}
+	return tags, len(tags) > 0
+}
+
+// etagPrecondition reports whether current (as returned by the resource's
+// ETag function) satisfies the If-Match/If-None-Match header value per
+// RFC 7232 section 3.1/3.2. strong selects the strong comparison function
+// required for If-Match; If-None-Match uses the weak one.
+func etagPrecondition(header, current string, strong bool) (bool, error) {
+	if header == "*" {
+		return current != "", nil
+	}
+	tags, ok := parseETagList(header)
+	if !ok {
+		return false, fmt.Errorf("webdav-patch: invalid entity-tag list %q", header)
+	}
+	cur, ok := parseSingleETag(current)
+	if !ok {
+		return false, nil
+	}
+	for _, t := range tags {
+		if strong && t.strongEquals(cur) {
+			return true, nil
+		}
+		if !strong && t.weakEquals(cur) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// computeETag returns the resource's current ETag, or "" if it doesn't
+// exist. It calls h.ETag when set, falling back to defaultETag otherwise.
+func (h *Handler) computeETag(ctx context.Context, fs webdav.FileSystem, reqPath string, exists bool) (string, error) {
+	if !exists {
+		return "", nil
+	}
+	fi, err := fs.Stat(ctx, reqPath)
+	if err != nil {
+		return "", err
+	}
+	etagFn := h.ETag
+	if etagFn == nil {
+		etagFn = defaultETag
+	}
+	return etagFn(ctx, reqPath, fi)
+}
+
+// defaultETag synthesises a strong ETag from a file's size, modification
+// time, and a hash of its name standing in for the inode number that the
+// webdav.FileSystem abstraction doesn't expose.
+func defaultETag(ctx context.Context, name string, fi os.FileInfo) (string, error) {
+	h := fnv.New64a()
+	io.WriteString(h, name)
+	return fmt.Sprintf(`"%x-%x-%x"`, fi.Size(), fi.ModTime().UnixNano(), h.Sum64()), nil
+}
@@ -0,0 +1,89 @@
+package webdavwithpath
+
+import "testing"
+
+func TestParseSingleETag(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		ok   bool
+		want eTag
+	}{
+		{name: "strong", in: `"abc"`, ok: true, want: eTag{value: "abc"}},
+		{name: "weak", in: `W/"abc"`, ok: true, want: eTag{weak: true, value: "abc"}},
+		{name: "empty value", in: `""`, ok: true, want: eTag{value: ""}},
+		{name: "surrounding whitespace", in: ` "abc" `, ok: true, want: eTag{value: "abc"}},
+		{name: "missing quotes", in: "abc", ok: false},
+		{name: "unterminated quote", in: `"abc`, ok: false},
+		{name: "empty string", in: "", ok: false},
+		{name: "bare weak prefix", in: "W/", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseSingleETag(tt.in)
+			if ok != tt.ok {
+				t.Fatalf("parseSingleETag(%q) ok = %v, want %v", tt.in, ok, tt.ok)
+			}
+			if ok && got != tt.want {
+				t.Errorf("parseSingleETag(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestETagStrongAndWeakEquals(t *testing.T) {
+	strongA := eTag{value: "abc"}
+	strongA2 := eTag{value: "abc"}
+	weakA := eTag{weak: true, value: "abc"}
+	strongB := eTag{value: "def"}
+
+	if !strongA.strongEquals(strongA2) {
+		t.Error("identical strong tags should strongly match")
+	}
+	if strongA.strongEquals(weakA) {
+		t.Error("a weak tag should never strongly match, even with the same value")
+	}
+	if strongA.strongEquals(strongB) {
+		t.Error("different values should never strongly match")
+	}
+	if !strongA.weakEquals(weakA) {
+		t.Error("weak comparison should ignore the weak/strong flag")
+	}
+}
+
+func TestEtagPrecondition(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		current string
+		strong  bool
+		want    bool
+		wantErr bool
+	}{
+		{name: "star matches any existing resource", header: "*", current: `"abc"`, want: true},
+		{name: "star does not match a missing resource", header: "*", current: "", want: false},
+		{name: "if-match strong match", header: `"abc"`, current: `"abc"`, strong: true, want: true},
+		{name: "if-match strong mismatch", header: `"abc"`, current: `"def"`, strong: true, want: false},
+		{name: "if-match strong comparison rejects a weak current tag", header: `"abc"`, current: `W/"abc"`, strong: true, want: false},
+		{name: "if-none-match weak comparison matches a weak current tag", header: `"abc"`, current: `W/"abc"`, strong: false, want: true},
+		{name: "list of tags matches if any one does", header: `"x", "abc"`, current: `"abc"`, strong: true, want: true},
+		{name: "invalid entity-tag list is an error", header: `not-a-tag`, current: `"abc"`, strong: true, wantErr: true},
+		{name: "unparseable current tag never matches", header: `"abc"`, current: "garbage", strong: true, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := etagPrecondition(tt.header, tt.current, tt.strong)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("etagPrecondition(%q, %q, %v) err = %v, wantErr %v", tt.header, tt.current, tt.strong, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("etagPrecondition(%q, %q, %v) = %v, want %v", tt.header, tt.current, tt.strong, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package webdavwithpath
+
+import (
+	"strings"
+
+	"golang.org/x/net/webdav"
+)
+
+// ifList is one "(" 1*Condition ")" production from the If header grammar,
+// optionally tagged with the resource it applies to. An empty resourceTag
+// means the list is untagged (the "No-tag-list" form) and applies to the
+// request's own target.
+type ifList struct {
+	resourceTag string
+	conditions  []webdav.Condition
+}
+
+// ifHeader is the parsed form of an RFC 4918 section 10.4.2 "If" header.
+// Its lists are evaluated as OR-of-ANDs: the header is satisfied if any
+// single list's conditions all hold.
+type ifHeader struct {
+	lists []ifList
+}
+
+// parseIfHeader parses the value of an HTTP "If" header per the grammar in
+// RFC 4918 section 10.4.2:
+//
+//	If = "If" ":" ( 1*No-tag-list | 1*Tagged-list )
+//	No-tag-list = List
+//	Tagged-list = Resource 1*List
+//	Resource = Coded-URL
+//	List = "(" 1*Condition ")"
+//	Condition = ["Not"] (Coded-URL | "[" entity-tag "]")
+//	Coded-URL = "<" absolute-URI ">"
+//
+// It is more lenient than that grammar in one respect: untagged lists may
+// precede tagged ones in the same header, and each applies to the request's
+// own target.
+//
+// golang.org/x/net/webdav does not export its equivalent parser, so this is
+// a port of it for use by our own PATCH handler.
+func parseIfHeader(s string) (h ifHeader, ok bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ifHeader{}, false
+	}
+	var resourceTag string
+	for s != "" {
+		if s[0] != '(' {
+			// Must be a Tagged-list: a Coded-URL precedes the List, and
+			// that tag carries forward to every List that follows it until
+			// the next Coded-URL or the end of the header.
+			u, rest, ok2 := scanCodedURL(s)
+			if !ok2 {
+				return ifHeader{}, false
+			}
+			resourceTag, s = u, strings.TrimLeft(rest, " \t")
+			if s == "" || s[0] != '(' {
+				return ifHeader{}, false
+			}
+		}
+		conditions, rest, ok2 := scanList(s)
+		if !ok2 {
+			return ifHeader{}, false
+		}
+		h.lists = append(h.lists, ifList{resourceTag: resourceTag, conditions: conditions})
+		s = strings.TrimLeft(rest, " \t")
+	}
+	if len(h.lists) == 0 {
+		return ifHeader{}, false
+	}
+	return h, true
+}
+
+// scanCodedURL scans a leading "<" ... ">" production, returning its
+// contents and what remains of s.
+func scanCodedURL(s string) (url, rest string, ok bool) {
+	s = strings.TrimLeft(s, " \t")
+	if s == "" || s[0] != '<' {
+		return "", s, false
+	}
+	i := strings.IndexByte(s, '>')
+	if i < 0 {
+		return "", s, false
+	}
+	return s[1:i], s[i+1:], true
+}
+
+// scanList scans a leading "(" 1*Condition ")" production.
+func scanList(s string) (conditions []webdav.Condition, rest string, ok bool) {
+	s = strings.TrimLeft(s, " \t")
+	if s == "" || s[0] != '(' {
+		return nil, s, false
+	}
+	s = s[1:]
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return nil, s, false
+		}
+		if s[0] == ')' {
+			s = s[1:]
+			break
+		}
+		var c webdav.Condition
+		if rest, ok2 := strings.CutPrefix(s, "Not"); ok2 && (rest == "" || rest[0] == ' ' || rest[0] == '\t') {
+			c.Not = true
+			s = strings.TrimLeft(rest, " \t")
+		}
+		switch {
+		case strings.HasPrefix(s, "<"):
+			token, rest, ok2 := scanCodedURL(s)
+			if !ok2 {
+				return nil, s, false
+			}
+			c.Token, s = token, rest
+		case strings.HasPrefix(s, "["):
+			i := strings.IndexByte(s, ']')
+			if i < 0 {
+				return nil, s, false
+			}
+			c.ETag, s = s[1:i], s[i+1:]
+		default:
+			return nil, s, false
+		}
+		conditions = append(conditions, c)
+	}
+	if len(conditions) == 0 {
+		return nil, s, false
+	}
+	return conditions, s, true
+}
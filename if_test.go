@@ -0,0 +1,108 @@
+package webdavwithpath
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestParseIfHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		hdr  string
+		ok   bool
+		want ifHeader
+	}{
+		{
+			name: "empty body is invalid",
+			hdr:  "",
+			ok:   false,
+		},
+		{
+			name: "whitespace-only body is invalid",
+			hdr:  "   ",
+			ok:   false,
+		},
+		{
+			name: "single untagged lock token",
+			hdr:  "(<urn:uuid:1>)",
+			ok:   true,
+			want: ifHeader{lists: []ifList{
+				{conditions: []webdav.Condition{{Token: "urn:uuid:1"}}},
+			}},
+		},
+		{
+			name: "untagged list with Not and an ETag",
+			hdr:  `(Not <urn:uuid:1> [W/"abc"])`,
+			ok:   true,
+			want: ifHeader{lists: []ifList{
+				{conditions: []webdav.Condition{
+					{Not: true, Token: "urn:uuid:1"},
+					{ETag: `W/"abc"`},
+				}},
+			}},
+		},
+		{
+			name: "tagged list",
+			hdr:  "</resource> (<urn:uuid:1>)",
+			ok:   true,
+			want: ifHeader{lists: []ifList{
+				{resourceTag: "/resource", conditions: []webdav.Condition{{Token: "urn:uuid:1"}}},
+			}},
+		},
+		{
+			name: "tagged list with multiple lists, OR semantics",
+			hdr:  "</resource> (<urn:uuid:1>) (<urn:uuid:2>)",
+			ok:   true,
+			want: ifHeader{lists: []ifList{
+				{resourceTag: "/resource", conditions: []webdav.Condition{{Token: "urn:uuid:1"}}},
+				{resourceTag: "/resource", conditions: []webdav.Condition{{Token: "urn:uuid:2"}}},
+			}},
+		},
+		{
+			name: "mixed tagged and untagged lists",
+			hdr:  "(<urn:uuid:1>) </resource> (<urn:uuid:2>)",
+			ok:   true,
+			want: ifHeader{lists: []ifList{
+				{conditions: []webdav.Condition{{Token: "urn:uuid:1"}}},
+				{resourceTag: "/resource", conditions: []webdav.Condition{{Token: "urn:uuid:2"}}},
+			}},
+		},
+		{
+			name: "unterminated list is invalid",
+			hdr:  "(<urn:uuid:1>",
+			ok:   false,
+		},
+		{
+			name: "empty list is invalid",
+			hdr:  "()",
+			ok:   false,
+		},
+		{
+			name: "resource tag without a following list is invalid",
+			hdr:  "</resource>",
+			ok:   false,
+		},
+		{
+			name: "condition that is neither Coded-URL nor entity-tag is invalid",
+			hdr:  "(Not)",
+			ok:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseIfHeader(tt.hdr)
+			if ok != tt.ok {
+				t.Fatalf("parseIfHeader(%q) ok = %v, want %v", tt.hdr, ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseIfHeader(%q) = %+v, want %+v", tt.hdr, got, tt.want)
+			}
+		})
+	}
+}
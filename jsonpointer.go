@@ -0,0 +1,194 @@
+package webdavwithpath
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// splitJSONPointer decodes an RFC 6901 JSON Pointer into its path segments.
+func splitJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("webdav-patch: json pointer %q must start with /", pointer)
+	}
+	raw := strings.Split(pointer[1:], "/")
+	tokens := make([]string, len(raw))
+	for i, t := range raw {
+		t = strings.ReplaceAll(t, "~1", "/")
+		t = strings.ReplaceAll(t, "~0", "~")
+		tokens[i] = t
+	}
+	return tokens, nil
+}
+
+// jsonPointerIndex resolves an array pointer token, treating "-" as the
+// one-past-the-end index per RFC 6901.
+func jsonPointerIndex(tok string, length int) (int, error) {
+	if tok == "-" {
+		return length, nil
+	}
+	idx, err := strconv.Atoi(tok)
+	if err != nil || idx < 0 {
+		return 0, fmt.Errorf("webdav-patch: json pointer: invalid array index %q", tok)
+	}
+	return idx, nil
+}
+
+// jsonPointerGet resolves pointer against doc.
+func jsonPointerGet(doc interface{}, pointer string) (interface{}, error) {
+	tokens, err := splitJSONPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	cur := doc
+	for _, tok := range tokens {
+		switch v := cur.(type) {
+		case map[string]interface{}:
+			next, ok := v[tok]
+			if !ok {
+				return nil, fmt.Errorf("webdav-patch: json pointer: no member %q", tok)
+			}
+			cur = next
+		case []interface{}:
+			idx, err := jsonPointerIndex(tok, len(v))
+			if err != nil {
+				return nil, err
+			}
+			if idx >= len(v) {
+				return nil, fmt.Errorf("webdav-patch: json pointer: array index %d out of range", idx)
+			}
+			cur = v[idx]
+		default:
+			return nil, fmt.Errorf("webdav-patch: json pointer: cannot index into %T", cur)
+		}
+	}
+	return cur, nil
+}
+
+// jsonPointerSet sets pointer to value within doc, returning the (possibly
+// new) root. insert controls whether the final array segment inserts
+// (RFC 6902 "add") or overwrites an existing index ("replace").
+func jsonPointerSet(doc interface{}, pointer string, value interface{}, insert bool) (interface{}, error) {
+	tokens, err := splitJSONPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return setAt(doc, tokens, value, insert)
+}
+
+func setAt(cur interface{}, tokens []string, value interface{}, insert bool) (interface{}, error) {
+	tok, last := tokens[0], len(tokens) == 1
+
+	switch v := cur.(type) {
+	case map[string]interface{}:
+		if last {
+			v[tok] = value
+			return v, nil
+		}
+		child, ok := v[tok]
+		if !ok {
+			return nil, fmt.Errorf("webdav-patch: json pointer: no member %q", tok)
+		}
+		updated, err := setAt(child, tokens[1:], value, insert)
+		if err != nil {
+			return nil, err
+		}
+		v[tok] = updated
+		return v, nil
+	case []interface{}:
+		idx, err := jsonPointerIndex(tok, len(v))
+		if err != nil {
+			return nil, err
+		}
+		if last {
+			if insert {
+				if idx > len(v) {
+					return nil, fmt.Errorf("webdav-patch: json pointer: array index %d out of range", idx)
+				}
+				v = append(v, nil)
+				copy(v[idx+1:], v[idx:])
+				v[idx] = value
+				return v, nil
+			}
+			if idx >= len(v) {
+				return nil, fmt.Errorf("webdav-patch: json pointer: array index %d out of range", idx)
+			}
+			v[idx] = value
+			return v, nil
+		}
+		if idx >= len(v) {
+			return nil, fmt.Errorf("webdav-patch: json pointer: array index %d out of range", idx)
+		}
+		updated, err := setAt(v[idx], tokens[1:], value, insert)
+		if err != nil {
+			return nil, err
+		}
+		v[idx] = updated
+		return v, nil
+	default:
+		return nil, fmt.Errorf("webdav-patch: json pointer: cannot index into %T", cur)
+	}
+}
+
+// jsonPointerRemove removes pointer from doc, returning the (possibly new) root.
+func jsonPointerRemove(doc interface{}, pointer string) (interface{}, error) {
+	tokens, err := splitJSONPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("webdav-patch: json pointer: cannot remove the whole document")
+	}
+	return removeAt(doc, tokens)
+}
+
+func removeAt(cur interface{}, tokens []string) (interface{}, error) {
+	tok, last := tokens[0], len(tokens) == 1
+
+	switch v := cur.(type) {
+	case map[string]interface{}:
+		if last {
+			if _, ok := v[tok]; !ok {
+				return nil, fmt.Errorf("webdav-patch: json pointer: no member %q", tok)
+			}
+			delete(v, tok)
+			return v, nil
+		}
+		child, ok := v[tok]
+		if !ok {
+			return nil, fmt.Errorf("webdav-patch: json pointer: no member %q", tok)
+		}
+		updated, err := removeAt(child, tokens[1:])
+		if err != nil {
+			return nil, err
+		}
+		v[tok] = updated
+		return v, nil
+	case []interface{}:
+		idx, err := jsonPointerIndex(tok, len(v))
+		if err != nil {
+			return nil, err
+		}
+		if idx >= len(v) {
+			return nil, fmt.Errorf("webdav-patch: json pointer: array index %d out of range", idx)
+		}
+		if last {
+			return append(v[:idx], v[idx+1:]...), nil
+		}
+		updated, err := removeAt(v[idx], tokens[1:])
+		if err != nil {
+			return nil, err
+		}
+		v[idx] = updated
+		return v, nil
+	default:
+		return nil, fmt.Errorf("webdav-patch: json pointer: cannot index into %T", cur)
+	}
+}
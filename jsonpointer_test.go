@@ -0,0 +1,196 @@
+package webdavwithpath
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitJSONPointer(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{name: "root pointer", in: "", want: nil},
+		{name: "single member", in: "/foo", want: []string{"foo"}},
+		{name: "nested members", in: "/foo/bar", want: []string{"foo", "bar"}},
+		{name: "escaped slash", in: "/a~1b", want: []string{"a/b"}},
+		{name: "escaped tilde", in: "/a~0b", want: []string{"a~b"}},
+		// ~1 must decode to "/" before ~0 decodes to "~", otherwise "~01"
+		// (escaped "~" followed by literal "1") would wrongly become "/".
+		{name: "escape order: ~01 decodes to ~1, not /", in: "/~01", want: []string{"~1"}},
+		{name: "missing leading slash is an error", in: "foo", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitJSONPointer(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitJSONPointer(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitJSONPointer(%q) = %#v, want %#v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONPointerGet(t *testing.T) {
+	doc := map[string]interface{}{
+		"foo": []interface{}{"a", "b", "c"},
+		"bar": map[string]interface{}{"baz": 1.0},
+	}
+
+	tests := []struct {
+		name    string
+		pointer string
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "whole document", pointer: "", want: doc},
+		{name: "object member", pointer: "/bar/baz", want: 1.0},
+		{name: "array index", pointer: "/foo/1", want: "b"},
+		{name: "missing member is an error", pointer: "/missing", wantErr: true},
+		{name: "out of range index is an error", pointer: "/foo/9", wantErr: true},
+		{name: "dash index is an error on get", pointer: "/foo/-", wantErr: true},
+		{name: "indexing into a scalar is an error", pointer: "/bar/baz/0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jsonPointerGet(doc, tt.pointer)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("jsonPointerGet(%q) err = %v, wantErr %v", tt.pointer, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("jsonPointerGet(%q) = %#v, want %#v", tt.pointer, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONPointerSet(t *testing.T) {
+	t.Run("replace an object member", func(t *testing.T) {
+		doc := map[string]interface{}{"foo": "a"}
+		got, err := jsonPointerSet(doc, "/foo", "b", false)
+		if err != nil {
+			t.Fatalf("jsonPointerSet: %v", err)
+		}
+		want := map[string]interface{}{"foo": "b"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %#v, want %#v", got, want)
+		}
+	})
+
+	t.Run("insert into an array shifts later elements", func(t *testing.T) {
+		doc := map[string]interface{}{"foo": []interface{}{"a", "c"}}
+		got, err := jsonPointerSet(doc, "/foo/1", "b", true)
+		if err != nil {
+			t.Fatalf("jsonPointerSet: %v", err)
+		}
+		want := map[string]interface{}{"foo": []interface{}{"a", "b", "c"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %#v, want %#v", got, want)
+		}
+	})
+
+	t.Run("dash appends to an array", func(t *testing.T) {
+		doc := map[string]interface{}{"foo": []interface{}{"a"}}
+		got, err := jsonPointerSet(doc, "/foo/-", "b", true)
+		if err != nil {
+			t.Fatalf("jsonPointerSet: %v", err)
+		}
+		want := map[string]interface{}{"foo": []interface{}{"a", "b"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %#v, want %#v", got, want)
+		}
+	})
+
+	t.Run("replace at an existing array index leaves length unchanged", func(t *testing.T) {
+		doc := map[string]interface{}{"foo": []interface{}{"a", "b"}}
+		got, err := jsonPointerSet(doc, "/foo/1", "z", false)
+		if err != nil {
+			t.Fatalf("jsonPointerSet: %v", err)
+		}
+		want := map[string]interface{}{"foo": []interface{}{"a", "z"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %#v, want %#v", got, want)
+		}
+	})
+
+	t.Run("root pointer replaces the whole document", func(t *testing.T) {
+		got, err := jsonPointerSet(map[string]interface{}{"foo": "a"}, "", "replaced", false)
+		if err != nil {
+			t.Fatalf("jsonPointerSet: %v", err)
+		}
+		if got != "replaced" {
+			t.Errorf("got %#v, want %#v", got, "replaced")
+		}
+	})
+
+	t.Run("setting through a missing intermediate member is an error", func(t *testing.T) {
+		doc := map[string]interface{}{}
+		if _, err := jsonPointerSet(doc, "/foo/bar", "x", false); err == nil {
+			t.Error("expected an error, got nil")
+		}
+	})
+
+	t.Run("replace out of range index without insert is an error", func(t *testing.T) {
+		doc := map[string]interface{}{"foo": []interface{}{"a"}}
+		if _, err := jsonPointerSet(doc, "/foo/5", "x", false); err == nil {
+			t.Error("expected an error, got nil")
+		}
+	})
+}
+
+func TestJSONPointerRemove(t *testing.T) {
+	t.Run("remove an object member", func(t *testing.T) {
+		doc := map[string]interface{}{"foo": "a", "bar": "b"}
+		got, err := jsonPointerRemove(doc, "/foo")
+		if err != nil {
+			t.Fatalf("jsonPointerRemove: %v", err)
+		}
+		want := map[string]interface{}{"bar": "b"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %#v, want %#v", got, want)
+		}
+	})
+
+	t.Run("remove an array element shifts later elements", func(t *testing.T) {
+		doc := map[string]interface{}{"foo": []interface{}{"a", "b", "c"}}
+		got, err := jsonPointerRemove(doc, "/foo/1")
+		if err != nil {
+			t.Fatalf("jsonPointerRemove: %v", err)
+		}
+		want := map[string]interface{}{"foo": []interface{}{"a", "c"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %#v, want %#v", got, want)
+		}
+	})
+
+	t.Run("removing the whole document is an error", func(t *testing.T) {
+		if _, err := jsonPointerRemove(map[string]interface{}{"foo": "a"}, ""); err == nil {
+			t.Error("expected an error, got nil")
+		}
+	})
+
+	t.Run("removing a missing member is an error", func(t *testing.T) {
+		if _, err := jsonPointerRemove(map[string]interface{}{}, "/missing"); err == nil {
+			t.Error("expected an error, got nil")
+		}
+	})
+
+	t.Run("removing an out of range index is an error", func(t *testing.T) {
+		doc := map[string]interface{}{"foo": []interface{}{"a"}}
+		if _, err := jsonPointerRemove(doc, "/foo/9"); err == nil {
+			t.Error("expected an error, got nil")
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package webdavwithpath
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+// sabredavPatchRequest builds a PATCH request for the built-in
+// application/x-sabredav-partialupdate handler, with the Content-Length
+// header sabredav itself parses set independently of body's actual length
+// so short-body and over-limit scenarios can be exercised.
+func sabredavPatchRequest(body string, declaredLength int, updateRange string) *http.Request {
+	req := httptest.NewRequest("PATCH", "/foo.txt", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-sabredav-partialupdate")
+	req.Header.Set("X-Update-Range", updateRange)
+	req.Header.Set("Content-Length", strconv.Itoa(declaredLength))
+	req.ContentLength = int64(len(body))
+	return req
+}
+
+// TestHandlePatchMaxPatchBytesExceeded verifies that a PATCH body cut off by
+// Handler.MaxPatchBytes surfaces as 413 Payload Too Large, not a generic 500.
+func TestHandlePatchMaxPatchBytesExceeded(t *testing.T) {
+	h := newTestHandler()
+	h.MaxPatchBytes = 5
+
+	req := sabredavPatchRequest(strings.Repeat("x", 10), 10, "bytes=0-9")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+// TestHandlePatchQuotaExceeded verifies that a PATCH body cut off by Quota
+// surfaces as 507 Insufficient Storage, distinct from hitting MaxPatchBytes.
+func TestHandlePatchQuotaExceeded(t *testing.T) {
+	h := newTestHandler()
+	h.Quota = func(ctx context.Context, reqPath string) (int64, error) {
+		return 5, nil
+	}
+
+	req := sabredavPatchRequest(strings.Repeat("x", 10), 10, "bytes=0-9")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInsufficientStorage {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusInsufficientStorage)
+	}
+}
+
+// TestHandlePatchRollsBackOnShortBody verifies that a byte-range PATCH that
+// fails partway through (a body shorter than its declared Content-Length)
+// leaves the file exactly as it was before the PATCH, not truncated at the
+// failed write's length and not left with a corrupted, over-length tail.
+// It uses a real disk-backed webdav.Dir rather than webdav.NewMemFS()
+// because the rollback truncates the file via the os.File Truncate method,
+// which the in-memory FileSystem's File doesn't implement.
+func TestHandlePatchRollsBackOnShortBody(t *testing.T) {
+	h := &Handler{
+		Handler: webdav.Handler{
+			FileSystem: webdav.Dir(t.TempDir()),
+			LockSystem: webdav.NewMemLS(),
+		},
+	}
+
+	put := httptest.NewRequest("PUT", "/foo.txt", strings.NewReader("abc"))
+	putRec := httptest.NewRecorder()
+	h.ServeHTTP(putRec, put)
+	if putRec.Code != http.StatusCreated {
+		t.Fatalf("seed PUT: got %d, want %d", putRec.Code, http.StatusCreated)
+	}
+
+	// Declares 10 bytes via bytes=0-9 but only sends 5: the write grows the
+	// 3-byte file before dying partway through.
+	req := sabredavPatchRequest("12345", 10, "bytes=0-9")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	get := httptest.NewRequest("GET", "/foo.txt", nil)
+	getRec := httptest.NewRecorder()
+	h.ServeHTTP(getRec, get)
+	if got, want := getRec.Body.String(), "abc"; got != want {
+		t.Errorf("file after failed PATCH = %q, want %q (rolled back to its pre-PATCH contents)", got, want)
+	}
+}
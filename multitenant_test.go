@@ -0,0 +1,83 @@
+package webdavwithpath
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+// TestHandlerResolveIsolatesTenants verifies that Resolve picks a distinct
+// FileSystem/LockSystem per request, so one tenant's writes are invisible to
+// another sharing the same Handler.
+func TestHandlerResolveIsolatesTenants(t *testing.T) {
+	fsA := webdav.NewMemFS()
+	fsB := webdav.NewMemFS()
+	h := &Handler{
+		Resolve: func(r *http.Request) (webdav.FileSystem, webdav.LockSystem, string, error) {
+			if r.Header.Get("X-Tenant") == "a" {
+				return fsA, webdav.NewMemLS(), "", nil
+			}
+			return fsB, webdav.NewMemLS(), "", nil
+		},
+	}
+
+	put := httptest.NewRequest("PUT", "/foo.txt", strings.NewReader("tenant a's file"))
+	put.Header.Set("X-Tenant", "a")
+	putRec := httptest.NewRecorder()
+	h.ServeHTTP(putRec, put)
+	if putRec.Code != http.StatusCreated {
+		t.Fatalf("seed PUT for tenant a: got %d, want %d", putRec.Code, http.StatusCreated)
+	}
+
+	getA := httptest.NewRequest("GET", "/foo.txt", nil)
+	getA.Header.Set("X-Tenant", "a")
+	recA := httptest.NewRecorder()
+	h.ServeHTTP(recA, getA)
+	if recA.Code != http.StatusOK || recA.Body.String() != "tenant a's file" {
+		t.Fatalf("tenant a GET: got %d %q", recA.Code, recA.Body.String())
+	}
+
+	getB := httptest.NewRequest("GET", "/foo.txt", nil)
+	getB.Header.Set("X-Tenant", "b")
+	recB := httptest.NewRecorder()
+	h.ServeHTTP(recB, getB)
+	if recB.Code == http.StatusOK {
+		t.Errorf("tenant b saw tenant a's file: got %d %q, want a 404", recB.Code, recB.Body.String())
+	}
+}
+
+// TestHandlerReadOnlyForRejectsWrites verifies that ReadOnlyFor actually
+// blocks mutating requests rather than only shaping the OPTIONS Allow
+// header.
+func TestHandlerReadOnlyForRejectsWrites(t *testing.T) {
+	fs := webdav.NewMemFS()
+	h := &Handler{
+		Handler: webdav.Handler{FileSystem: fs, LockSystem: webdav.NewMemLS()},
+		ReadOnlyFor: func(r *http.Request) bool {
+			return r.Header.Get("X-Tenant") == "readonly"
+		},
+	}
+
+	put := httptest.NewRequest("PUT", "/foo.txt", strings.NewReader("x"))
+	put.Header.Set("X-Tenant", "readonly")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, put)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("PUT from a read-only tenant: got %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if _, err := fs.Stat(context.Background(), "/foo.txt"); err == nil {
+		t.Error("a rejected read-only PUT should not have created the file")
+	}
+
+	put2 := httptest.NewRequest("PUT", "/foo.txt", strings.NewReader("x"))
+	put2.Header.Set("X-Tenant", "writer")
+	rec2 := httptest.NewRecorder()
+	h.ServeHTTP(rec2, put2)
+	if rec2.Code != http.StatusCreated {
+		t.Fatalf("PUT from a writer tenant: got %d, want %d", rec2.Code, http.StatusCreated)
+	}
+}
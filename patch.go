@@ -0,0 +1,59 @@
+package webdavwithpath
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/webdav"
+)
+
+// PatchFunc handles one PATCH Content-Type. It is called only after the
+// request's locks and preconditions have already been confirmed, and is
+// responsible for reading r.Body and applying it to reqPath through fs.
+type PatchFunc func(ctx context.Context, fs webdav.FileSystem, reqPath string, exists bool, r *http.Request) (status int, err error)
+
+// defaultPatchHandlers is used whenever Handler.PatchHandlers is nil.
+var defaultPatchHandlers = map[string]PatchFunc{
+	"application/x-sabredav-partialupdate": patchSabredav,
+	"application/json-patch+json":          patchJSON,
+	"application/http":                     patchMultiRange,
+}
+
+// patchHandlers returns the media-type registry PATCH requests dispatch
+// through, falling back to the built-in handlers.
+func (h *Handler) patchHandlers() map[string]PatchFunc {
+	if h.PatchHandlers != nil {
+		return h.PatchHandlers
+	}
+	return defaultPatchHandlers
+}
+
+// acceptPatch returns the sorted, comma-separated list of Content-Types this
+// Handler accepts for PATCH, for the Accept-Patch response header.
+func (h *Handler) acceptPatch() string {
+	handlers := h.patchHandlers()
+	types := make([]string, 0, len(handlers))
+	for t := range handlers {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return strings.Join(types, ", ")
+}
+
+// patchContentType extracts the media type from a PATCH request's
+// Content-Type header, ignoring parameters such as charset.
+func patchContentType(r *http.Request) (string, error) {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return "", errors.New("webdav-patch: missing Content-Type")
+	}
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return "", err
+	}
+	return mediaType, nil
+}
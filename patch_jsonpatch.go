@@ -0,0 +1,166 @@
+package webdavwithpath
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// jsonPatchOp is one operation in an RFC 6902 JSON Patch document.
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// patchJSON implements the application/json-patch+json PATCH Content-Type
+// (RFC 6902): the request body is a JSON Patch document applied to the
+// target resource, which must already exist and contain a JSON document.
+// The result is written back atomically via a temp file plus rename.
+func patchJSON(ctx context.Context, fs webdav.FileSystem, reqPath string, exists bool, r *http.Request) (status int, err error) {
+	if !exists {
+		return http.StatusNotFound, errors.New("webdav-patch: json-patch target does not exist")
+	}
+
+	var ops []jsonPatchOp
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("webdav-patch: invalid JSON Patch body: %w", err)
+	}
+
+	f, err := fs.OpenFile(ctx, reqPath, os.O_RDONLY, 0666)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	raw, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return http.StatusUnprocessableEntity, fmt.Errorf("webdav-patch: target is not valid JSON: %w", err)
+	}
+
+	for _, op := range ops {
+		doc, err = applyJSONPatchOp(doc, op)
+		if err != nil {
+			return http.StatusConflict, err
+		}
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err := writeFileAtomic(ctx, fs, reqPath, out); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// applyJSONPatchOp applies a single RFC 6902 operation to doc and returns
+// the (possibly new) document root.
+func applyJSONPatchOp(doc interface{}, op jsonPatchOp) (interface{}, error) {
+	switch op.Op {
+	case "add":
+		var value interface{}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, fmt.Errorf("webdav-patch: json-patch add: %w", err)
+		}
+		return jsonPointerSet(doc, op.Path, value, true)
+	case "replace":
+		var value interface{}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, fmt.Errorf("webdav-patch: json-patch replace: %w", err)
+		}
+		return jsonPointerSet(doc, op.Path, value, false)
+	case "remove":
+		return jsonPointerRemove(doc, op.Path)
+	case "move":
+		value, err := jsonPointerGet(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		doc, err = jsonPointerRemove(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerSet(doc, op.Path, value, true)
+	case "copy":
+		value, err := jsonPointerGet(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerSet(doc, op.Path, deepCopyJSON(value), true)
+	case "test":
+		var want interface{}
+		if err := json.Unmarshal(op.Value, &want); err != nil {
+			return nil, fmt.Errorf("webdav-patch: json-patch test: %w", err)
+		}
+		got, err := jsonPointerGet(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(got, want) {
+			return nil, fmt.Errorf("webdav-patch: json-patch test failed at %q", op.Path)
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("webdav-patch: unknown json-patch op %q", op.Op)
+	}
+}
+
+func deepCopyJSON(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(vv))
+		for k, val := range vv {
+			m[k] = deepCopyJSON(val)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(vv))
+		for i, val := range vv {
+			s[i] = deepCopyJSON(val)
+		}
+		return s
+	default:
+		return vv
+	}
+}
+
+// writeFileAtomic writes data to reqPath by writing it to a sibling temp
+// file and renaming that into place, so an error mid-write never leaves a
+// truncated or half-patched file behind.
+func writeFileAtomic(ctx context.Context, fs webdav.FileSystem, reqPath string, data []byte) error {
+	tmpPath := fmt.Sprintf("%s.webdav-patch-tmp-%d", reqPath, time.Now().UnixNano())
+	f, err := fs.OpenFile(ctx, tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	_, werr := f.Write(data)
+	cerr := f.Close()
+	if werr != nil {
+		fs.RemoveAll(ctx, tmpPath)
+		return werr
+	}
+	if cerr != nil {
+		fs.RemoveAll(ctx, tmpPath)
+		return cerr
+	}
+	if err := fs.Rename(ctx, tmpPath, reqPath); err != nil {
+		fs.RemoveAll(ctx, tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package webdavwithpath
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/webdav"
+)
+
+// patchMultiRange implements the application/http PATCH Content-Type: the
+// body is a sequence of parts, each a "Content-Range: bytes start-end/*"
+// header line, a blank line, and exactly (end-start+1) raw bytes, letting a
+// client update several disjoint regions of a file in one request. Each
+// part is snapshotted before it's written, so if a later part fails (a
+// malformed header, a short body, ...) every already-applied part is rolled
+// back: the PATCH is all-or-nothing. Undoing a part that grew the file
+// relies on truncateTo, so on a FileSystem whose File has no Truncate
+// method the overwritten bytes are restored but the extra length stays.
+func patchMultiRange(ctx context.Context, fs webdav.FileSystem, reqPath string, exists bool, r *http.Request) (status int, err error) {
+	f, err := fs.OpenFile(ctx, reqPath, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return http.StatusMethodNotAllowed, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(r.Body)
+	const prefix = "Content-Range: bytes "
+	parts := 0
+	var snaps []*regionSnapshot
+	restoreAll := func() {
+		// Newest first, so each snapshot's truncate-back sees the file as it
+		// was right after the parts before it were applied.
+		for i := len(snaps) - 1; i >= 0; i-- {
+			snaps[i].restore(f)
+		}
+	}
+	for {
+		header, rerr := br.ReadString('\n')
+		line := strings.TrimSpace(header)
+		if line == "" {
+			if rerr != nil {
+				break
+			}
+			continue // tolerate stray blank lines between parts
+		}
+		if !strings.HasPrefix(line, prefix) {
+			restoreAll()
+			return http.StatusBadRequest, fmt.Errorf("webdav-patch: expected %q, got %q", prefix, line)
+		}
+
+		rangeSpec, _, _ := strings.Cut(strings.TrimPrefix(line, prefix), "/")
+		startS, endS, ok := strings.Cut(rangeSpec, "-")
+		if !ok {
+			restoreAll()
+			return http.StatusBadRequest, fmt.Errorf("webdav-patch: invalid Content-Range %q", line)
+		}
+		start, serr := strconv.ParseInt(startS, 10, 64)
+		end, eerr := strconv.ParseInt(endS, 10, 64)
+		if serr != nil || eerr != nil || end < start {
+			restoreAll()
+			return http.StatusRequestedRangeNotSatisfiable, fmt.Errorf("webdav-patch: invalid Content-Range %q", line)
+		}
+
+		blank, berr := br.ReadString('\n')
+		if strings.TrimSpace(blank) != "" {
+			restoreAll()
+			return http.StatusBadRequest, errors.New("webdav-patch: expected blank line after Content-Range")
+		}
+		if berr != nil && berr != io.EOF {
+			restoreAll()
+			return http.StatusBadRequest, berr
+		}
+
+		length := end - start + 1
+		snap, serr := snapshotRegion(ctx, fs, reqPath, f, start, length)
+		if serr != nil {
+			restoreAll()
+			return http.StatusInternalServerError, serr
+		}
+		snaps = append(snaps, snap)
+
+		if _, err := f.Seek(start, io.SeekStart); err != nil {
+			restoreAll()
+			return http.StatusInternalServerError, err
+		}
+		if _, err := io.CopyN(f, br, length); err != nil {
+			restoreAll()
+			return http.StatusBadRequest, fmt.Errorf("webdav-patch: short part body for %q: %w", line, err)
+		}
+		parts++
+
+		if rerr != nil {
+			break
+		}
+	}
+	if parts == 0 {
+		return http.StatusBadRequest, errors.New("webdav-patch: application/http body had no Content-Range parts")
+	}
+
+	if exists {
+		return http.StatusOK, nil
+	}
+	return http.StatusCreated, nil
+}
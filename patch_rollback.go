@@ -0,0 +1,88 @@
+package webdavwithpath
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// regionSnapshotMemThreshold is the largest region snapshotRegion will hold
+// in memory; beyond that it spills to a sibling temp file so a single big
+// byte-range PATCH can't balloon server memory.
+const regionSnapshotMemThreshold = 4 << 20 // 4 MiB
+
+// regionSnapshot remembers the pre-PATCH contents of a byte range, plus the
+// file's pre-PATCH size, so a failed write can be rolled back with restore.
+type regionSnapshot struct {
+	start    int64
+	fileSize int64  // f's size before the write, restored by truncating back to it
+	buf      []byte // set when the region fit in memory
+	tmp      string // sibling temp file path, set otherwise
+	fs       webdav.FileSystem
+	ctx      context.Context
+}
+
+// snapshotRegion reads the n bytes of f starting at start (fewer, if the
+// file is shorter) so they can later be restored. f's offset is left
+// unspecified; callers must Seek before writing.
+func snapshotRegion(ctx context.Context, fs webdav.FileSystem, reqPath string, f webdav.File, start, n int64) (*regionSnapshot, error) {
+	var fileSize int64
+	if fi, err := f.Stat(); err == nil {
+		fileSize = fi.Size()
+	}
+
+	if n <= 0 {
+		return &regionSnapshot{start: start, fileSize: fileSize}, nil
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if n <= regionSnapshotMemThreshold {
+		buf := make([]byte, n)
+		read, err := io.ReadFull(f, buf)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return nil, err
+		}
+		return &regionSnapshot{start: start, fileSize: fileSize, buf: buf[:read]}, nil
+	}
+
+	tmpPath := fmt.Sprintf("%s.webdav-patch-snapshot-%d", reqPath, time.Now().UnixNano())
+	tmp, err := fs.OpenFile(ctx, tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(tmp, f, n); err != nil && err != io.EOF {
+		tmp.Close()
+		fs.RemoveAll(ctx, tmpPath)
+		return nil, err
+	}
+	tmp.Close()
+	return &regionSnapshot{start: start, fileSize: fileSize, tmp: tmpPath, fs: fs, ctx: ctx}, nil
+}
+
+// restore writes the snapshotted bytes back to f at their original offset,
+// then truncates f back to its pre-PATCH size so a write that grew the file
+// before failing doesn't leave a corrupted, over-length tail. It is
+// best-effort: errors are swallowed since it only ever runs while already
+// unwinding a failed PATCH.
+func (s *regionSnapshot) restore(f webdav.File) {
+	if _, err := f.Seek(s.start, io.SeekStart); err != nil {
+		return
+	}
+	if s.tmp != "" {
+		tmp, err := s.fs.OpenFile(s.ctx, s.tmp, os.O_RDONLY, 0666)
+		if err == nil {
+			io.Copy(f, tmp)
+			tmp.Close()
+		}
+		s.fs.RemoveAll(s.ctx, s.tmp)
+	} else if len(s.buf) > 0 {
+		f.Write(s.buf)
+	}
+	truncateTo(f, s.fileSize)
+}
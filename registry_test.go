@@ -0,0 +1,87 @@
+package webdavwithpath
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func newTestHandler() *Handler {
+	return &Handler{
+		Handler: webdav.Handler{
+			FileSystem: webdav.NewMemFS(),
+			LockSystem: webdav.NewMemLS(),
+		},
+	}
+}
+
+// TestHandlerPatchDispatchesThroughRegistry verifies that ServeHTTP routes a
+// PATCH request through Handler.PatchHandlers by Content-Type, instead of
+// the hard-coded single handler this request replaced, and that a
+// Content-Type absent from the registry is rejected rather than silently
+// falling back to a built-in handler.
+func TestHandlerPatchDispatchesThroughRegistry(t *testing.T) {
+	h := newTestHandler()
+
+	put := httptest.NewRequest("PUT", "/foo.txt", strings.NewReader("hello"))
+	putRec := httptest.NewRecorder()
+	h.ServeHTTP(putRec, put)
+	if putRec.Code != http.StatusCreated {
+		t.Fatalf("seed PUT: got %d, want %d", putRec.Code, http.StatusCreated)
+	}
+
+	var calledPath string
+	h.PatchHandlers = map[string]PatchFunc{
+		"application/x-custom-patch": func(ctx context.Context, fs webdav.FileSystem, reqPath string, exists bool, r *http.Request) (int, error) {
+			calledPath = reqPath
+			return http.StatusOK, nil
+		},
+	}
+
+	req := httptest.NewRequest("PATCH", "/foo.txt", nil)
+	req.Header.Set("Content-Type", "application/x-custom-patch")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PATCH with registered Content-Type: got %d, want %d", rec.Code, http.StatusOK)
+	}
+	if calledPath != "/foo.txt" {
+		t.Errorf("custom PatchFunc saw reqPath %q, want %q", calledPath, "/foo.txt")
+	}
+
+	req2 := httptest.NewRequest("PATCH", "/foo.txt", nil)
+	req2.Header.Set("Content-Type", "application/x-sabredav-partialupdate")
+	rec2 := httptest.NewRecorder()
+	h.ServeHTTP(rec2, req2)
+	if rec2.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("PATCH with unregistered Content-Type: got %d, want %d", rec2.Code, http.StatusUnsupportedMediaType)
+	}
+}
+
+// TestHandlerOptionsAcceptPatchFromRegistry verifies that OPTIONS advertises
+// Accept-Patch from the live PatchHandlers registry rather than a fixed
+// built-in list.
+func TestHandlerOptionsAcceptPatchFromRegistry(t *testing.T) {
+	h := newTestHandler()
+	h.PatchHandlers = map[string]PatchFunc{
+		"application/x-custom-patch": func(context.Context, webdav.FileSystem, string, bool, *http.Request) (int, error) {
+			return http.StatusOK, nil
+		},
+	}
+
+	put := httptest.NewRequest("PUT", "/foo.txt", strings.NewReader("hello"))
+	h.ServeHTTP(httptest.NewRecorder(), put)
+
+	req := httptest.NewRequest("OPTIONS", "/foo.txt", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got, want := rec.Header().Get("Accept-Patch"), "application/x-custom-patch"; got != want {
+		t.Errorf("Accept-Patch = %q, want %q", got, want)
+	}
+}
@@ -1,11 +1,12 @@
 package webdavwithpath
 
 import (
+	"context"
 	"errors"
-	"io"
+	"fmt"
 	"net/http"
+	"net/url"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
@@ -15,38 +16,90 @@ import (
 type Handler struct {
 	webdav.Handler
 	ReadOnly bool
+
+	// PatchHandlers maps a PATCH Content-Type to the PatchFunc that handles
+	// it. A nil map (the zero value) falls back to the built-in handlers
+	// for application/x-sabredav-partialupdate, application/json-patch+json
+	// and application/http.
+	PatchHandlers map[string]PatchFunc
+
+	// ETag computes the entity tag of a resource, mirroring the convention
+	// of golang.org/x/net/webdav's internal findETag. A nil ETag falls back
+	// to defaultETag.
+	ETag func(ctx context.Context, name string, fi os.FileInfo) (string, error)
+
+	// MaxPatchBytes caps how many bytes a single PATCH request body may
+	// contain; 0 means unlimited.
+	MaxPatchBytes int64
+
+	// Quota, when set, is consulted before each PATCH body is read and
+	// returns how many more bytes reqPath's owner may still write.
+	Quota func(ctx context.Context, reqPath string) (remaining int64, err error)
+
+	// Resolve, when set, picks the FileSystem, LockSystem and effective
+	// Prefix to use for r instead of the fields above, e.g. from an
+	// authenticated user carried in its context. It is consulted on every
+	// request, which lets a single Handler/mux serve many users with
+	// isolated lock namespaces and chrooted file trees.
+	Resolve func(r *http.Request) (fs webdav.FileSystem, ls webdav.LockSystem, prefix string, err error)
+
+	// ReadOnlyFor, when set, overrides ReadOnly per request. A nil
+	// ReadOnlyFor falls back to ReadOnly. Either way, ServeHTTP rejects any
+	// request whose method mutates state (PUT, DELETE, MKCOL, PROPPATCH,
+	// MOVE, LOCK, UNLOCK, PATCH) with 403 when the request is read-only.
+	ReadOnlyFor func(r *http.Request) bool
+}
+
+// resolve returns the FileSystem, LockSystem and Prefix to use for r,
+// consulting Resolve when set and falling back to the Handler's own fields
+// otherwise.
+func (h *Handler) resolve(r *http.Request) (fs webdav.FileSystem, ls webdav.LockSystem, prefix string, err error) {
+	if h.Resolve != nil {
+		return h.Resolve(r)
+	}
+	return h.FileSystem, h.LockSystem, h.Prefix, nil
+}
+
+// readOnly reports whether r should be treated as read-only, consulting
+// ReadOnlyFor when set and falling back to ReadOnly otherwise.
+func (h *Handler) readOnly(r *http.Request) bool {
+	if h.ReadOnlyFor != nil {
+		return h.ReadOnlyFor(r)
+	}
+	return h.ReadOnly
 }
 
 // Just copy from original webdav
-func (h *Handler) stripPrefix(p string) (string, int, error) {
-	if h.Prefix == "" {
+func (h *Handler) stripPrefix(p, prefix string) (string, int, error) {
+	if prefix == "" {
 		return p, http.StatusOK, nil
 	}
-	if r := strings.TrimPrefix(p, h.Prefix); len(r) < len(p) {
+	if r := strings.TrimPrefix(p, prefix); len(r) < len(p) {
 		return r, http.StatusOK, nil
 	}
 	return p, http.StatusNotFound, errors.New("webdav-patch: prefix mismatch")
 }
 
-func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request) (status int, err error) {
-	reqPath, status, err := h.stripPrefix(r.URL.Path)
+func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request, fs webdav.FileSystem, prefix string, readOnly bool) (status int, err error) {
+	reqPath, status, err := h.stripPrefix(r.URL.Path, prefix)
 	if err != nil {
 		return status, err
 	}
 	ctx := r.Context()
 	allow := "OPTIONS, LOCK, PUT, MKCOL"
-	if fi, err := h.FileSystem.Stat(ctx, reqPath); err == nil {
+	if fi, err := fs.Stat(ctx, reqPath); err == nil {
 		if fi.IsDir() {
-			if h.ReadOnly {
+			if readOnly {
 				allow = "OPTIONS, COPY, PROPFIND"
 			} else {
 				allow = "OPTIONS, LOCK, DELETE, PROPPATCH, COPY, MOVE, UNLOCK, PROPFIND"
 			}
 		} else {
-			if h.ReadOnly {
+			if readOnly {
 				allow = "OPTIONS, GET, HEAD, POST, PROPFIND"
 			} else {
 				allow = "OPTIONS, LOCK, GET, HEAD, POST, DELETE, PROPPATCH, COPY, MOVE, UNLOCK, PROPFIND, PUT, PATCH"
+				w.Header().Set("Accept-Patch", h.acceptPatch())
 			}
 		}
 	}
@@ -55,203 +108,273 @@ func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request) (status
 	w.Header().Set("DAV", "1, 2, sabredav-partialupdate")
 	// http://msdn.microsoft.com/en-au/library/cc250217.aspx
 	w.Header().Set("MS-Author-Via", "DAV")
-	return 0, nil
+	return http.StatusOK, nil
 }
 
 // Partial copy from original webdav
-func (h *Handler) confirmLocks(r *http.Request, src, dst string) (release func(), status int, err error) {
+func (h *Handler) confirmLocks(r *http.Request, fs webdav.FileSystem, ls webdav.LockSystem, prefix, src, dst string) (release func(), status int, err error) {
 	hdr := r.Header.Get("If")
-	if hdr != "" {
-		return nil, http.StatusNotImplemented, errors.New("webdav-patch: non-empty `If` header")
-	}
-
-	// An empty If header means that the client hasn't previously created locks.
-	// Even if this client doesn't care about locks, we still need to check that
-	// the resources aren't locked by another client, so we create temporary
-	// locks that would conflict with another client's locks. These temporary
-	// locks are unlocked at the end of the HTTP request.
-	now, token := time.Now(), ""
-	if src != "" {
-		token, err = h.LockSystem.Create(now, webdav.LockDetails{
-			Root:      src,
-			Duration:  -1, // infiniteTimeout
-			ZeroDepth: true,
-		})
-		if err != nil {
-			if err == webdav.ErrLocked {
-				return nil, http.StatusLocked, err
+	if hdr == "" {
+		// An empty If header means that the client hasn't previously created locks.
+		// Even if this client doesn't care about locks, we still need to check that
+		// the resources aren't locked by another client, so we create temporary
+		// locks that would conflict with another client's locks. These temporary
+		// locks are unlocked at the end of the HTTP request.
+		now, token := time.Now(), ""
+		if src != "" {
+			token, err = ls.Create(now, webdav.LockDetails{
+				Root:      src,
+				Duration:  -1, // infiniteTimeout
+				ZeroDepth: true,
+			})
+			if err != nil {
+				if err == webdav.ErrLocked {
+					return nil, http.StatusLocked, err
+				}
+				return nil, http.StatusInternalServerError, err
 			}
-			return nil, http.StatusInternalServerError, err
-		}
-	}
-
-	return func() {
-		if token != "" {
-			h.LockSystem.Unlock(now, token)
 		}
-	}, 0, nil
-}
-
-func (h *Handler) handlePatchAppend(reqPath string, exists bool, length int64, r *http.Request) (status int, err error) {
-	ctx := r.Context()
-	f, err := h.FileSystem.OpenFile(ctx, reqPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		return http.StatusMethodNotAllowed, err
-	}
-	defer f.Close()
-
-	_, err = io.Copy(f, r.Body)
-	if err != nil {
-		return http.StatusInternalServerError, err
-	}
 
-	if exists {
-		return http.StatusOK, nil
-	} else {
-		return http.StatusCreated, nil
+		return func() {
+			if token != "" {
+				ls.Unlock(now, token)
+			}
+		}, 0, nil
 	}
-}
 
-func (h *Handler) handlePatchBytes(reqPath string, exists bool, bytes string, length int64, r *http.Request) (status int, err error) {
-	parts := strings.Split(bytes, "-")
-	if len(parts) != 2 {
-		return http.StatusBadRequest, errors.New("webdav-patch: invalid bytes in X-Update-Range")
+	ih, ok := parseIfHeader(hdr)
+	if !ok {
+		return nil, http.StatusBadRequest, errors.New("webdav-patch: invalid `If` header")
 	}
 
-	ctx := r.Context()
-	f, err := h.FileSystem.OpenFile(ctx, reqPath, os.O_RDWR|os.O_CREATE, 0666)
-	if err != nil {
-		return http.StatusMethodNotAllowed, err
-	}
-	defer f.Close()
+	// Try each list in turn (OR semantics); the first list whose conditions
+	// are all confirmed wins. Unlike the empty-header case above, no
+	// temporary lock is created here: the release closure comes straight
+	// from LockSystem.Confirm and only drops the hold Confirm placed on the
+	// caller's locks, never unlocking them.
+	now := time.Now()
+	for _, l := range ih.lists {
+		lsrc := l.resourceTag
+		if lsrc == "" {
+			// Untagged list: applies to the request's own target, even if
+			// that target is the root ("").
+			lsrc = src
+		} else if u, uerr := url.Parse(lsrc); uerr == nil {
+			if p, _, serr := h.stripPrefix(u.Path, prefix); serr == nil {
+				lsrc = p
+			} else {
+				lsrc = u.Path
+			}
+		}
 
-	fi, err := f.Stat()
-	if err != nil {
-		return http.StatusInternalServerError, errors.New("webdav-patch: can't stat file")
-	}
-	size := fi.Size()
+		// Entity-tag conditions aren't something LockSystem.Confirm knows
+		// about, so check them against our own etagger here (ANDed with the
+		// lock-token conditions below) and pass only the latter on.
+		lockConditions, etagsOK, eerr := h.confirmETagConditions(r.Context(), fs, lsrc, l.conditions)
+		if eerr != nil {
+			return nil, http.StatusInternalServerError, eerr
+		}
+		if !etagsOK {
+			continue
+		}
 
-	var start, end int64
-	// Parse end
-	if len(parts[1]) > 0 {
-		end, err = strconv.ParseInt(parts[1], 10, 64)
+		release, err = ls.Confirm(now, lsrc, dst, lockConditions...)
 		if err != nil {
-			return http.StatusRequestedRangeNotSatisfiable, err
+			continue
 		}
+		return release, 0, nil
 	}
-	// Parse start
-	if len(parts[0]) > 0 {
-		// bytes=A-B
-		start, err = strconv.ParseInt(parts[0], 10, 64)
-		if err != nil {
-			return http.StatusRequestedRangeNotSatisfiable, err
+	return nil, http.StatusPreconditionFailed, errors.New("webdav-patch: no `If` list could be confirmed")
+}
+
+// confirmETagConditions splits conditions into the entity-tag conditions,
+// which it checks immediately against lsrc's current ETag, and the
+// remaining lock-token conditions, which the caller passes on to
+// LockSystem.Confirm. ok is false as soon as one entity-tag condition
+// fails to hold.
+func (h *Handler) confirmETagConditions(ctx context.Context, fs webdav.FileSystem, lsrc string, conditions []webdav.Condition) (lockConditions []webdav.Condition, ok bool, err error) {
+	for _, c := range conditions {
+		if c.ETag == "" {
+			lockConditions = append(lockConditions, c)
+			continue
 		}
-		// bytes=N-
-		if len(parts[1]) == 0 {
-			end = start + length - 1
+
+		_, statErr := fs.Stat(ctx, lsrc)
+		exists := statErr == nil
+		current, cerr := h.computeETag(ctx, fs, lsrc, exists)
+		if cerr != nil {
+			return nil, false, cerr
 		}
-	} else { // bytes=-N
-		if len(parts[1]) == 0 {
-			return http.StatusRequestedRangeNotSatisfiable, errors.New("webdav-patch: empty bytes in X-Update-Range")
+		want, wok := parseSingleETag(c.ETag)
+		got, gok := parseSingleETag(current)
+		matched := wok && gok && want.strongEquals(got)
+		if c.Not {
+			matched = !matched
+		}
+		if !matched {
+			return nil, false, nil
 		}
-		start = size - end
-		end = start + length - 1
-	}
-
-	// There is no information anywhere about what to do in this case.
-	// And itâ€™s not clear why we need to specify the end position if we have the length of the content.
-	// I decided to throw an error if the numbers diverge.
-	if end-start != length-1 {
-		return http.StatusBadRequest, errors.New("webdav-patch: empty bytes in X-Update-Range")
-	}
-	if start < 0 {
-		return http.StatusBadRequest, errors.New("webdav-patch: X-Update-Range start < 0")
-	}
-
-	f.Seek(start, io.SeekStart)
-	_, err = io.Copy(f, r.Body)
-	if err != nil {
-		return http.StatusInternalServerError, err
-	}
-
-	if exists {
-		return http.StatusOK, nil
-	} else {
-		return http.StatusCreated, nil
 	}
+	return lockConditions, true, nil
 }
 
 // https://sabre.io/dav/http-patch/
-func (h *Handler) handlePatch(w http.ResponseWriter, r *http.Request) (status int, err error) {
-	reqPath, status, err := h.stripPrefix(r.URL.Path)
+func (h *Handler) handlePatch(w http.ResponseWriter, r *http.Request, fs webdav.FileSystem, ls webdav.LockSystem, prefix string) (status int, err error) {
+	reqPath, status, err := h.stripPrefix(r.URL.Path, prefix)
 	if err != nil {
 		return status, err
 	}
-	release, status, err := h.confirmLocks(r, reqPath, "")
+	release, status, err := h.confirmLocks(r, fs, ls, prefix, reqPath, "")
 	if err != nil {
 		return status, err
 	}
 	defer release()
 
-	_, err = h.FileSystem.Stat(r.Context(), reqPath)
+	_, err = fs.Stat(r.Context(), reqPath)
 	var exists bool
-	if err == nil {
+	switch {
+	case err == nil:
 		exists = true
-	}
-	if err == os.ErrNotExist {
+	case errors.Is(err, os.ErrNotExist):
 		exists = false
-	} else {
+	default:
 		return http.StatusInternalServerError, err
 	}
 
-	ifMatch := r.Header.Get("If-Match")
-	if ifMatch != "" {
-		if ifMatch != "*" {
-			return http.StatusNotImplemented, errors.New("webdav-patch: only `If-Match: *` supported")
+	currentETag, err := h.computeETag(r.Context(), fs, reqPath, exists)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		matched, merr := etagPrecondition(ifMatch, currentETag, true)
+		if merr != nil {
+			return http.StatusBadRequest, merr
 		}
-		if !exists {
+		if !matched {
 			return http.StatusPreconditionFailed, nil
 		}
 	}
 
-	ifNoneMatch := r.Header.Get("If-None-Match")
-	if ifNoneMatch != "" {
-		if ifNoneMatch != "*" {
-			return http.StatusNotImplemented, errors.New("webdav-patch: only `If-None-Match: *` supported")
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		matched, merr := etagPrecondition(ifNoneMatch, currentETag, false)
+		if merr != nil {
+			return http.StatusBadRequest, merr
 		}
-		if exists {
+		if matched {
 			return http.StatusPreconditionFailed, nil
 		}
 	}
 
-	contentType := r.Header.Get("Content-Type")
-	if contentType != "application/x-sabredav-partialupdate" {
-		return http.StatusUnsupportedMediaType, errors.New("webdav-patch: content-type must be application/x-sabredav-partialupdate")
+	mediaType, err := patchContentType(r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	patch, ok := h.patchHandlers()[mediaType]
+	if !ok {
+		return http.StatusUnsupportedMediaType, fmt.Errorf("webdav-patch: unsupported Content-Type %q", mediaType)
 	}
 
-	contentLength := r.Header.Get("Content-Length")
-	length, err := strconv.ParseInt(contentLength, 10, 64)
+	quotaLimited, err := h.boundPatchBody(w, r, reqPath)
 	if err != nil {
-		return http.StatusLengthRequired, err
+		return http.StatusInternalServerError, err
 	}
+	status, err = patch(r.Context(), fs, reqPath, exists, r)
+	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			// The body was cut off by boundPatchBody, not a server fault: a
+			// quota overrun is the tenant's storage running out (507), while
+			// hitting MaxPatchBytes or a lying Content-Length is the
+			// client's payload being too large (413).
+			if quotaLimited {
+				return http.StatusInsufficientStorage, err
+			}
+			return http.StatusRequestEntityTooLarge, err
+		}
+	}
+	return status, err
+}
 
-	updateRange := r.Header.Get("X-Update-Range")
-	bytes, has := strings.CutPrefix(updateRange, "bytes=")
-	if has {
-		return h.handlePatchBytes(reqPath, exists, bytes, length, r)
+// boundPatchBody wraps r.Body in an http.MaxBytesReader sized to the
+// tightest of the declared Content-Length, Handler.MaxPatchBytes and the
+// caller's remaining quota, so a client that lies about Content-Length (or
+// streams forever) can't fill the disk. quotaLimited reports whether Quota
+// was the limit that applied, so callers can tell a quota overrun (507) from
+// an oversized payload (413) once the bound trips.
+func (h *Handler) boundPatchBody(w http.ResponseWriter, r *http.Request, reqPath string) (quotaLimited bool, err error) {
+	limit := int64(-1)
+	tighten := func(v int64, fromQuota bool) {
+		if v >= 0 && (limit < 0 || v < limit) {
+			limit = v
+			quotaLimited = fromQuota
+		}
 	}
-	if updateRange == "append" {
-		return h.handlePatchAppend(reqPath, exists, length, r)
+
+	if h.MaxPatchBytes > 0 {
+		tighten(h.MaxPatchBytes, false)
+	}
+	tighten(r.ContentLength, false)
+
+	if h.Quota != nil {
+		remaining, err := h.Quota(r.Context(), reqPath)
+		if err != nil {
+			return false, err
+		}
+		if remaining < 0 {
+			remaining = 0
+		}
+		tighten(remaining, true)
 	}
-	return http.StatusBadRequest, errors.New("webdav-patch: X-Update-Range must be `bytes=` or `append`")
+
+	if limit >= 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	return quotaLimited, nil
+}
+
+// writeMethods are the HTTP methods readOnly/ReadOnlyFor forbid: everything
+// handleOptions omits from the read-only Allow string above. GET, HEAD,
+// POST, PROPFIND, COPY and OPTIONS stay allowed since they don't mutate the
+// resource they're issued against.
+var writeMethods = map[string]bool{
+	"PUT":       true,
+	"DELETE":    true,
+	"MKCOL":     true,
+	"PROPPATCH": true,
+	"MOVE":      true,
+	"LOCK":      true,
+	"UNLOCK":    true,
+	"PATCH":     true,
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fs, ls, prefix, err := h.resolve(r)
+	if err != nil {
+		status := http.StatusInternalServerError
+		w.WriteHeader(status)
+		w.Write([]byte(webdav.StatusText(status)))
+		if h.Logger != nil {
+			h.Logger(r, err)
+		}
+		return
+	}
+
+	if writeMethods[r.Method] && h.readOnly(r) {
+		status := http.StatusForbidden
+		w.WriteHeader(status)
+		w.Write([]byte(webdav.StatusText(status)))
+		if h.Logger != nil {
+			h.Logger(r, nil)
+		}
+		return
+	}
+
 	pass := false
-	if h.FileSystem == nil {
+	if fs == nil {
 		pass = true
 	}
-	if h.LockSystem == nil {
+	if ls == nil {
 		pass = true
 	}
 	if r.Method != "PATCH" && r.Method != "OPTIONS" {
@@ -262,9 +385,9 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		status := http.StatusBadRequest
 		switch r.Method {
 		case "OPTIONS":
-			status, err = h.handleOptions(w, r)
+			status, err = h.handleOptions(w, r, fs, prefix, h.readOnly(r))
 		case "PATCH":
-			status, err = h.handlePatch(w, r)
+			status, err = h.handlePatch(w, r, fs, ls, prefix)
 		}
 
 		w.WriteHeader(status)
@@ -276,7 +399,14 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 
 	} else {
-		h.Handler.ServeHTTP(w, r)
+		// Delegate to the embedded webdav.Handler using a shallow copy so
+		// the resolved FileSystem/LockSystem/Prefix apply to this request
+		// without mutating the shared Handler for other requests.
+		wh := h.Handler
+		wh.FileSystem = fs
+		wh.LockSystem = ls
+		wh.Prefix = prefix
+		wh.ServeHTTP(w, r)
 	}
 
 }